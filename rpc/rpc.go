@@ -2,11 +2,17 @@ package rpc
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,6 +20,14 @@ import (
 	"github.com/MiningPool0826/xmrpool/pool"
 )
 
+const (
+	maxIdleConns        = 50
+	maxIdleConnsPerHost = 10
+	idleConnTimeout     = 90 * time.Second
+)
+
+var digestParamRe = regexp.MustCompile(`(\w+)="([^"]*)"|(\w+)=([^,\s]+)`)
+
 type RPCClient struct {
 	sync.RWMutex
 	sickRate         int64
@@ -23,12 +37,26 @@ type RPCClient struct {
 	LastSubmissionAt int64
 	FailsCount       int64
 	Url              *url.URL
-	//login            string
-	//password         string
-	Name   string
-	sick   bool
-	client *http.Client
-	info   atomic.Value
+	Login            string
+	Password         string
+	Name             string
+	Weight           int64
+	sick             bool
+	client           *http.Client
+	info             atomic.Value
+	digest           digestState
+}
+
+// digestState caches the nonce/opaque/qop handed out by monerod's
+// --rpc-login endpoints, plus the nonce-count.
+type digestState struct {
+	sync.Mutex
+	realm     string
+	nonce     string
+	opaque    string
+	qop       string
+	algorithm string
+	nc        uint32
 }
 
 type GetBlockTemplateReply struct {
@@ -88,14 +116,51 @@ func NewRPCClient(cfg *pool.Upstream) (*RPCClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	rpcClient := &RPCClient{Name: cfg.Name, Url: url}
+	weight := cfg.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	rpcClient := &RPCClient{Name: cfg.Name, Url: url, Login: cfg.Login, Password: cfg.Password, Weight: weight}
 	timeout, _ := time.ParseDuration(cfg.Timeout)
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
 	rpcClient.SetClient(&http.Client{
 		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        maxIdleConns,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
+			IdleConnTimeout:     idleConnTimeout,
+		},
 	})
 	return rpcClient, nil
 }
 
+type Call struct {
+	Method string
+	Params interface{}
+}
+
+func (r *RPCClient) Batch() *batchBuilder {
+	return &batchBuilder{client: r}
+}
+
+type batchBuilder struct {
+	client *RPCClient
+	calls  []Call
+}
+
+func (b *batchBuilder) Add(method string, params interface{}) *batchBuilder {
+	b.calls = append(b.calls, Call{Method: method, Params: params})
+	return b
+}
+
+func (b *batchBuilder) Do() ([]JSONRpcResp, error) {
+	return b.client.doBatch(b.calls)
+}
+
 func (r *RPCClient) SetClient(client *http.Client) {
 	r.client = client
 }
@@ -156,15 +221,35 @@ func (r *RPCClient) GetBlockHeaderByHeight(height int64) (*GetBlockHeaderReply,
 	return reply, err
 }
 
+type GetBlockHeadersRangeReply struct {
+	Headers   []BlockHeader `json:"headers"`
+	Status    string        `json:"status"`
+	Untrusted bool          `json:"untrusted"`
+}
+
+// GetBlockHeadersRange fetches headers for [start, end] in one round-trip,
+// capped by monerod at 1000 headers per call.
+func (r *RPCClient) GetBlockHeadersRange(start, end int64) ([]BlockHeader, error) {
+	params := map[string]interface{}{"start_height": start, "end_height": end}
+	rpcResp, err := r.doPost(r.Url.String(), "get_block_headers_range", params)
+	var reply *GetBlockHeadersRangeReply
+	if err != nil {
+		return nil, err
+	}
+	if rpcResp.Result != nil {
+		err = json.Unmarshal(*rpcResp.Result, &reply)
+	}
+	if reply == nil {
+		return nil, err
+	}
+	return reply.Headers, err
+}
+
 func (r *RPCClient) doPost(url, method string, params interface{}) (*JSONRpcResp, error) {
 	jsonReq := map[string]interface{}{"jsonrpc": "2.0", "id": 0, "method": method, "params": params}
 	data, _ := json.Marshal(jsonReq)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
-	req.Header.Set("Content-Length", (string)(len(data)))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	//req.SetBasicAuth(r.login, r.password)
-	resp, err := r.client.Do(req)
+
+	resp, err := r.postWithDigest(url, data)
 	if err != nil {
 		r.markSick()
 		return nil, err
@@ -188,6 +273,150 @@ func (r *RPCClient) doPost(url, method string, params interface{}) (*JSONRpcResp
 	return rpcResp, err
 }
 
+// postWithDigest POSTs data to url, attaching a cached Digest Authorization
+// header if we hold one, and retrying once against a fresh challenge on 401.
+func (r *RPCClient) postWithDigest(url string, data []byte) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if header := r.digestAuthHeader("POST", req.URL.RequestURI()); header != "" {
+		req.Header.Set("Authorization", header)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized || r.Login == "" {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if challenge == "" {
+		return resp, nil
+	}
+	if err := r.cacheDigestChallenge(challenge); err != nil {
+		return nil, err
+	}
+
+	req, err = http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", r.digestAuthHeader("POST", req.URL.RequestURI()))
+	return r.client.Do(req)
+}
+
+func (r *RPCClient) cacheDigestChallenge(header string) error {
+	params := parseDigestHeader(header)
+	if params["realm"] == "" || params["nonce"] == "" {
+		return errors.New("malformed WWW-Authenticate header")
+	}
+	r.digest.Lock()
+	defer r.digest.Unlock()
+	r.digest.realm = params["realm"]
+	r.digest.nonce = params["nonce"]
+	r.digest.opaque = params["opaque"]
+	r.digest.qop = params["qop"]
+	r.digest.algorithm = params["algorithm"]
+	r.digest.nc = 0
+	return nil
+}
+
+// digestAuthHeader builds an Authorization: Digest header from the cached
+// nonce, incrementing nc on every call.
+func (r *RPCClient) digestAuthHeader(method, uri string) string {
+	r.digest.Lock()
+	defer r.digest.Unlock()
+	if r.digest.nonce == "" {
+		return ""
+	}
+	r.digest.nc++
+	nc := fmt.Sprintf("%08x", r.digest.nc)
+	cnonce := fmt.Sprintf("%08x", rand.Uint32())
+
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", r.Login, r.digest.realm, r.Password))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", method, uri))
+
+	qop := r.digest.qop
+	if qop == "" {
+		qop = "auth"
+	}
+	response := md5Hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, r.digest.nonce, nc, cnonce, qop, ha2))
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=%s, nc=%s, cnonce="%s", response="%s"`,
+		r.Login, r.digest.realm, r.digest.nonce, uri, qop, nc, cnonce, response)
+	if r.digest.opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, r.digest.opaque)
+	}
+	return header
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseDigestHeader(header string) map[string]string {
+	header = strings.TrimPrefix(header, "Digest ")
+	params := make(map[string]string)
+	for _, match := range digestParamRe.FindAllStringSubmatch(header, -1) {
+		if match[1] != "" {
+			params[match[1]] = match[2]
+		} else {
+			params[match[3]] = match[4]
+		}
+	}
+	return params
+}
+
+func (r *RPCClient) doBatch(methods []Call) ([]JSONRpcResp, error) {
+	batch := make([]map[string]interface{}, len(methods))
+	for i, call := range methods {
+		batch[i] = map[string]interface{}{"jsonrpc": "2.0", "id": i, "method": call.Method, "params": call.Params}
+	}
+	data, _ := json.Marshal(batch)
+
+	resp, err := r.postWithDigest(r.Url.String(), data)
+	if err != nil {
+		r.markSick()
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return nil, errors.New(resp.Status)
+	}
+
+	var rawResps []JSONRpcResp
+	if err := json.NewDecoder(resp.Body).Decode(&rawResps); err != nil {
+		r.markSick()
+		return nil, err
+	}
+
+	replies := make([]JSONRpcResp, len(methods))
+	for _, rr := range rawResps {
+		if rr.Id == nil {
+			continue
+		}
+		var idx int
+		if err := json.Unmarshal(*rr.Id, &idx); err != nil || idx < 0 || idx >= len(replies) {
+			continue
+		}
+		replies[idx] = rr
+	}
+	r.markAlive()
+	return replies, nil
+}
+
 func (r *RPCClient) Check(reserveSize int, address string) (bool, error) {
 	_, err := r.GetBlockTemplate(reserveSize, address)
 	if err != nil {
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDoBatchDemuxesOutOfOrderReplies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var reqs []map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&reqs); err != nil {
+			t.Fatalf("decode batch request: %v", err)
+		}
+
+		// Reply in reverse order to prove doBatch demuxes by id, not position.
+		resps := make([]map[string]interface{}, len(reqs))
+		for i, rq := range reqs {
+			j := len(reqs) - 1 - i
+			resps[j] = map[string]interface{}{"jsonrpc": "2.0", "id": rq["id"], "result": map[string]interface{}{"height": rq["id"]}}
+		}
+		json.NewEncoder(w).Encode(resps)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	r := &RPCClient{Url: u}
+	r.SetClient(srv.Client())
+
+	calls := []Call{
+		{Method: "getblockheaderbyheight", Params: map[string]interface{}{"height": 1}},
+		{Method: "getblockheaderbyheight", Params: map[string]interface{}{"height": 2}},
+		{Method: "getblockheaderbyheight", Params: map[string]interface{}{"height": 3}},
+	}
+	replies, err := r.doBatch(calls)
+	if err != nil {
+		t.Fatalf("doBatch: %v", err)
+	}
+	if len(replies) != len(calls) {
+		t.Fatalf("got %d replies, want %d", len(replies), len(calls))
+	}
+	for i, reply := range replies {
+		var result struct {
+			Height int `json:"height"`
+		}
+		if err := json.Unmarshal(*reply.Result, &result); err != nil {
+			t.Fatalf("reply %d: %v", i, err)
+		}
+		if result.Height != i {
+			t.Errorf("reply %d: got height %d, want %d", i, result.Height, i)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseDigestHeader(t *testing.T) {
+	header := `Digest realm="monero-rpc", qop="auth", nonce="abc123", opaque="xyz", algorithm=MD5`
+	params := parseDigestHeader(header)
+
+	want := map[string]string{
+		"realm":     "monero-rpc",
+		"qop":       "auth",
+		"nonce":     "abc123",
+		"opaque":    "xyz",
+		"algorithm": "MD5",
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("params[%q] = %q, want %q", k, params[k], v)
+		}
+	}
+}
+
+func TestDigestAuthHeaderMatchesRFC2617Response(t *testing.T) {
+	r := &RPCClient{Login: "user", Password: "pass"}
+	if err := r.cacheDigestChallenge(`Digest realm="monero-rpc", nonce="n0nce", qop="auth"`); err != nil {
+		t.Fatalf("cacheDigestChallenge: %v", err)
+	}
+
+	header := r.digestAuthHeader("POST", "/json_rpc")
+	if !strings.HasPrefix(header, "Digest ") {
+		t.Fatalf("header missing Digest prefix: %q", header)
+	}
+
+	ha1 := md5Hex("user:monero-rpc:pass")
+	ha2 := md5Hex("POST:/json_rpc")
+	wantResponse := md5Hex(fmt.Sprintf("%s:n0nce:00000001:", ha1) + extractCnonce(t, header) + ":auth:" + ha2)
+
+	if !strings.Contains(header, `response="`+wantResponse+`"`) {
+		t.Errorf("header %q does not contain expected response %q", header, wantResponse)
+	}
+}
+
+func extractCnonce(t *testing.T, header string) string {
+	t.Helper()
+	const key = `cnonce="`
+	i := strings.Index(header, key)
+	if i < 0 {
+		t.Fatalf("header %q missing cnonce", header)
+	}
+	rest := header[i+len(key):]
+	return rest[:strings.Index(rest, `"`)]
+}
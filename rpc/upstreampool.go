@@ -0,0 +1,168 @@
+package rpc
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrNoHealthyUpstream = errors.New("no healthy upstream available")
+
+// UpstreamPool routes calls to a sticky primary, failing over to a
+// weighted-random pick among the other healthy clients when the primary
+// goes sick.
+type UpstreamPool struct {
+	sync.RWMutex
+	clients []*RPCClient
+	primary int
+}
+
+// NewUpstreamPool builds a pool from already-constructed clients, in
+// priority order (index 0 is the initial primary; after a failover Primary
+// reports the client picked by the failover).
+func NewUpstreamPool(clients []*RPCClient) *UpstreamPool {
+	return &UpstreamPool{clients: clients}
+}
+
+func (p *UpstreamPool) Primary() *RPCClient {
+	p.RLock()
+	defer p.RUnlock()
+	return p.clients[p.primary]
+}
+
+func (p *UpstreamPool) Clients() []*RPCClient {
+	p.RLock()
+	defer p.RUnlock()
+	return p.clients
+}
+
+func (p *UpstreamPool) active() (*RPCClient, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.clients[p.primary].Sick() {
+		return p.clients[p.primary], nil
+	}
+
+	var totalWeight int64
+	healthyIdx := make([]int, 0, len(p.clients))
+	for i, c := range p.clients {
+		if !c.Sick() {
+			healthyIdx = append(healthyIdx, i)
+			totalWeight += c.Weight
+		}
+	}
+	if len(healthyIdx) == 0 {
+		return nil, ErrNoHealthyUpstream
+	}
+
+	idx := weightedPick(p.clients, healthyIdx, totalWeight)
+	log.Printf("Upstream %s is sick, failing over to %s", p.clients[p.primary].Name, p.clients[idx].Name)
+	p.primary = idx
+	return p.clients[idx], nil
+}
+
+// weightedPick falls back to a uniform pick when totalWeight <= 0 (e.g.
+// every candidate's Weight is the unset zero value), instead of calling
+// rand.Int63n(0), which panics.
+func weightedPick(clients []*RPCClient, candidateIdx []int, totalWeight int64) int {
+	if totalWeight <= 0 {
+		return candidateIdx[rand.Intn(len(candidateIdx))]
+	}
+
+	pick := rand.Int63n(totalWeight)
+	for _, i := range candidateIdx {
+		if pick < clients[i].Weight {
+			return i
+		}
+		pick -= clients[i].Weight
+	}
+	return candidateIdx[len(candidateIdx)-1]
+}
+
+func (p *UpstreamPool) GetBlockTemplate(reserveSize int, address string) (*GetBlockTemplateReply, error) {
+	c, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetBlockTemplate(reserveSize, address)
+}
+
+func (p *UpstreamPool) GetInfo() (*GetInfoReply, error) {
+	c, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetInfo()
+}
+
+func (p *UpstreamPool) GetBlockCount() (*GetBlockCountReply, error) {
+	c, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetBlockCount()
+}
+
+func (p *UpstreamPool) SubmitBlock(hash string) (*JSONRpcResp, error) {
+	c, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	return c.SubmitBlock(hash)
+}
+
+func (p *UpstreamPool) GetBlockHeaderByHeight(height int64) (*GetBlockHeaderReply, error) {
+	c, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetBlockHeaderByHeight(height)
+}
+
+func (p *UpstreamPool) GetBlockHeadersRange(start, end int64) ([]BlockHeader, error) {
+	c, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetBlockHeadersRange(start, end)
+}
+
+// SubmitBlockAll broadcasts a found block to every configured daemon in
+// parallel, to minimize orphan risk when one node is behind.
+func (p *UpstreamPool) SubmitBlockAll(hash string) []error {
+	clients := p.Clients()
+	errs := make([]error, len(clients))
+
+	var wg sync.WaitGroup
+	wg.Add(len(clients))
+	for i, c := range clients {
+		go func(i int, c *RPCClient) {
+			defer wg.Done()
+			_, err := c.SubmitBlock(hash)
+			errs[i] = err
+		}(i, c)
+	}
+	wg.Wait()
+	return errs
+}
+
+// HealthLoop periodically re-checks sick clients with Check, folding a
+// recovered node back into rotation.
+func (p *UpstreamPool) HealthLoop(interval time.Duration, reserveSize int, address string) {
+	for {
+		time.Sleep(interval)
+		for _, c := range p.Clients() {
+			if !c.Sick() {
+				continue
+			}
+			if ok, err := c.Check(reserveSize, address); err != nil {
+				log.Printf("Upstream %s still sick: %v", c.Name, err)
+			} else if ok {
+				log.Printf("Upstream %s recovered", c.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package rpc
+
+import "testing"
+
+func TestWeightedPickZeroWeightFallsBackToUniform(t *testing.T) {
+	clients := []*RPCClient{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	candidateIdx := []int{0, 1, 2}
+
+	for i := 0; i < 100; i++ {
+		idx := weightedPick(clients, candidateIdx, 0)
+		if idx < 0 || idx >= len(clients) {
+			t.Fatalf("weightedPick returned out-of-range index %d", idx)
+		}
+	}
+}
+
+func TestWeightedPickOnlyReturnsPositiveWeightCandidates(t *testing.T) {
+	clients := []*RPCClient{{Name: "a", Weight: 0}, {Name: "b", Weight: 5}}
+	candidateIdx := []int{0, 1}
+
+	for i := 0; i < 100; i++ {
+		idx := weightedPick(clients, candidateIdx, 5)
+		if idx != 1 {
+			t.Fatalf("weightedPick picked zero-weight candidate %d", idx)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pebbe/zmq4"
+
+	"github.com/MiningPool0826/xmrpool/pool"
+)
+
+const (
+	topicChainMain = "json-minimal-chain_main"
+	topicTxPoolAdd = "json-full-txpool_add"
+
+	recvErrorBackoff         = time.Second
+	maxConsecutiveRecvErrors = 10
+)
+
+// BlockNotification is the decoded payload of a json-minimal-chain_main
+// ZMQ message.
+type BlockNotification struct {
+	Height       int64  `json:"height"`
+	PrevHash     string `json:"prev_hash"`
+	MajorVersion int    `json:"major_version"`
+}
+
+// ZMQSubscriber listens on monerod's ZMQ pub socket and forwards decoded
+// block-notification events. It is a best-effort companion to the HTTP
+// polling path, not a replacement for it.
+type ZMQSubscriber struct {
+	sync.RWMutex
+	client      *RPCClient
+	addr        string
+	sock        *zmq4.Socket
+	events      chan *BlockNotification
+	stop        chan struct{}
+	running     bool
+	closeEvents sync.Once
+}
+
+// NewZMQSubscriber returns nil, nil when cfg.ZmqAddr is unset, so callers
+// can fall back to polling without special-casing the disabled state.
+func NewZMQSubscriber(client *RPCClient, cfg *pool.Upstream) (*ZMQSubscriber, error) {
+	if cfg.ZmqAddr == "" {
+		return nil, nil
+	}
+	sock, err := zmq4.NewSocket(zmq4.SUB)
+	if err != nil {
+		return nil, err
+	}
+	if err := sock.Connect(cfg.ZmqAddr); err != nil {
+		sock.Close()
+		return nil, err
+	}
+	if err := sock.SetSubscribe(topicChainMain); err != nil {
+		sock.Close()
+		return nil, err
+	}
+	if err := sock.SetSubscribe(topicTxPoolAdd); err != nil {
+		sock.Close()
+		return nil, err
+	}
+	return &ZMQSubscriber{
+		client: client,
+		addr:   cfg.ZmqAddr,
+		sock:   sock,
+		events: make(chan *BlockNotification, 16),
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+func (z *ZMQSubscriber) Events() <-chan *BlockNotification {
+	return z.events
+}
+
+// Run blocks receiving messages until Stop is called, or until
+// maxConsecutiveRecvErrors receive errors in a row, after which it closes the
+// socket and the Events channel; launch with `go sub.Run()`.
+func (z *ZMQSubscriber) Run() {
+	z.Lock()
+	z.running = true
+	z.Unlock()
+
+	consecutiveErrors := 0
+	for {
+		select {
+		case <-z.stop:
+			return
+		default:
+		}
+
+		parts, err := z.sock.RecvMessage(0)
+		if err != nil {
+			log.Printf("ZMQ subscriber on %s: %v", z.addr, err)
+			z.client.markSick()
+			consecutiveErrors++
+			if consecutiveErrors >= maxConsecutiveRecvErrors {
+				log.Printf("ZMQ subscriber on %s: giving up after %d consecutive errors, falling back to polling", z.addr, consecutiveErrors)
+				z.Lock()
+				z.sock.Close()
+				z.running = false
+				z.Unlock()
+				z.closeEvents.Do(func() { close(z.events) })
+				return
+			}
+			select {
+			case <-z.stop:
+				return
+			case <-time.After(recvErrorBackoff):
+			}
+			continue
+		}
+		consecutiveErrors = 0
+		if len(parts) != 2 {
+			continue
+		}
+		topic, payload := parts[0], parts[1]
+		if !strings.HasPrefix(topic, topicChainMain) {
+			continue
+		}
+
+		var notif BlockNotification
+		if err := json.Unmarshal([]byte(payload), &notif); err != nil {
+			log.Printf("ZMQ subscriber on %s: malformed %s payload: %v", z.addr, topic, err)
+			continue
+		}
+		z.client.markAlive()
+
+		select {
+		case z.events <- &notif:
+		default:
+			// broker is behind; next poll still picks up the new height
+		}
+	}
+}
+
+// Stop tears down the subscriber and closes the underlying socket.
+func (z *ZMQSubscriber) Stop() {
+	z.Lock()
+	if !z.running {
+		z.Unlock()
+		return
+	}
+	close(z.stop)
+	z.sock.Close()
+	z.running = false
+	z.Unlock()
+	z.closeEvents.Do(func() { close(z.events) })
+}